@@ -0,0 +1,183 @@
+// Copyright Praegressus Limited. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpmp provides an http.Handler and Middleware
+// implementing RFC 7396 JSON Merge Patch for HTTP PATCH requests
+// with the application/merge-patch+json content type.
+package httpmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	jsonmp "github.com/martingallagher/go-jsonmp"
+)
+
+// MediaType is the RFC 7396 JSON Merge Patch media type.
+const MediaType = "application/merge-patch+json"
+
+// ErrConflict is returned by a PutFunc to signal that the
+// resource changed concurrently; Handler responds with
+// 409 Conflict.
+var ErrConflict = errors.New("httpmp: conflict")
+
+// GetFunc loads the current representation of the resource
+// targeted by r.
+type GetFunc func(r *http.Request) ([]byte, error)
+
+// PutFunc stores the merged representation of the resource
+// targeted by r. Returning ErrConflict causes Handler to respond
+// with 409 Conflict; any other error is reported as
+// 500 Internal Server Error.
+type PutFunc func(r *http.Request, merged []byte) error
+
+// ValidateFunc validates a merged document before it is stored.
+// A non-nil error is reported to the client as 400 Bad Request.
+type ValidateFunc func(merged []byte) error
+
+// Option configures a Handler or Middleware.
+type Option func(*options)
+
+type options struct {
+	validate    ValidateFunc
+	writeMerged bool
+}
+
+// Validate registers fn to run against the merged document
+// before it is passed to PutFunc.
+func Validate(fn ValidateFunc) Option {
+	return func(o *options) { o.validate = fn }
+}
+
+// WriteMergedResponse causes the merged document to be written
+// back to the client as the response body on success, rather
+// than an empty 200 OK.
+func WriteMergedResponse() Option {
+	return func(o *options) { o.writeMerged = true }
+}
+
+// Handler returns an http.Handler implementing RFC 7396 JSON
+// Merge Patch semantics for PATCH requests: it rejects requests
+// that aren't application/merge-patch+json with 415, loads the
+// current resource with get, streams the request body onto it as
+// a merge patch via jsonmp.StreamingPatcher, and stores the
+// result with put.
+func Handler(get GetFunc, put PutFunc, opts ...Option) http.Handler {
+	o := &options{}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &handler{get, put, o}
+}
+
+// Middleware returns middleware that intercepts PATCH requests
+// carrying the application/merge-patch+json content type and
+// handles them per Handler, delegating everything else to next.
+func Middleware(get GetFunc, put PutFunc, opts ...Option) func(http.Handler) http.Handler {
+	h := Handler(get, put, opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPatch || r.Header.Get("Content-Type") != MediaType {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+type handler struct {
+	get GetFunc
+	put PutFunc
+	o   *options
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if r.Header.Get("Content-Type") != MediaType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil || !json.Valid(body) {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	current, err := h.get(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	// Stream the merge rather than unmarshalling current into an
+	// interface{} tree of the (potentially large) resource.
+	var buf bytes.Buffer
+
+	sp := jsonmp.NewStreamingPatcher(bytes.NewReader(current), bytes.NewReader(body), &buf)
+
+	if err := sp.Patch(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	merged := buf.Bytes()
+
+	if h.o.validate != nil {
+		if err := h.o.validate(merged); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if err := h.put(r, merged); err != nil {
+		if errors.Is(err, ErrConflict) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if !h.o.writeMerged {
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(merged)
+}
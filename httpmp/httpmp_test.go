@@ -0,0 +1,123 @@
+package httpmp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerMerge(t *testing.T) {
+	current := []byte(`{"title":"Goodbye!","author":"John"}`)
+
+	var put []byte
+
+	h := Handler(
+		func(r *http.Request) ([]byte, error) { return current, nil },
+		func(r *http.Request, merged []byte) error { put = merged; return nil },
+		WriteMergedResponse(),
+	)
+
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"title":"Hello!","author":null}`))
+	r.Header.Set("Content-Type", MediaType)
+
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	const want = `{"title":"Hello!"}`
+
+	if string(put) != want {
+		t.Fatalf("incorrect stored document: %s != %s", put, want)
+	}
+
+	if w.Body.String() != want {
+		t.Fatalf("incorrect response body: %s != %s", w.Body.String(), want)
+	}
+}
+
+func TestHandlerWrongContentType(t *testing.T) {
+	h := Handler(
+		func(r *http.Request) ([]byte, error) { return []byte(`{}`), nil },
+		func(r *http.Request, merged []byte) error { return nil },
+	)
+
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", w.Code)
+	}
+}
+
+func TestHandlerConflict(t *testing.T) {
+	h := Handler(
+		func(r *http.Request) ([]byte, error) { return []byte(`{}`), nil },
+		func(r *http.Request, merged []byte) error { return ErrConflict },
+	)
+
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"a":1}`))
+	r.Header.Set("Content-Type", MediaType)
+
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestHandlerMalformedPatch(t *testing.T) {
+	h := Handler(
+		func(r *http.Request) ([]byte, error) { return []byte(`{}`), nil },
+		func(r *http.Request, merged []byte) error { return nil },
+	)
+
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`not json`))
+	r.Header.Set("Content-Type", MediaType)
+
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var called bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	mw := Middleware(
+		func(r *http.Request) ([]byte, error) { return []byte(`{}`), nil },
+		func(r *http.Request, merged []byte) error { return nil },
+	)(next)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	mw.ServeHTTP(w, r)
+
+	if !called {
+		t.Fatal("expected non-PATCH requests to reach next")
+	}
+
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("expected 418, got %d", w.Code)
+	}
+}
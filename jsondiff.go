@@ -0,0 +1,123 @@
+// Copyright Praegressus Limited. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonmp
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Diff computes the minimal RFC 7386 merge patch p such that
+// Patch(a, p) produces b. A null member of an object in b cannot
+// be expressed in a merge patch: it is emitted as null, which
+// Patch treats as a removal, so Patch(a, p) lacks that member.
+func Diff(a, b []byte) ([]byte, error) {
+	var x, y interface{}
+
+	if err := json.Unmarshal(a, &x); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &y); err != nil {
+		return nil, err
+	}
+
+	d, err := DiffValue(x, y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(d)
+}
+
+// DiffValue computes the minimal RFC 7386 merge patch interface
+// value such that PatchValue(a, p, &dst) produces a value equal
+// to b.
+func DiffValue(a, b interface{}) (interface{}, error) {
+	var err error
+
+	if a, err = coerce(a); err != nil {
+		return nil, err
+	}
+
+	if b, err = coerce(b); err != nil {
+		return nil, err
+	}
+
+	if d := diff(a, b); d != unchanged {
+		return d, nil
+	}
+
+	return b, nil
+}
+
+// unchanged is a sentinel returned by diff to signal that a's and
+// b's subtrees are equal, so the caller should omit the key
+// entirely rather than emit a patch value for it.
+var unchanged = &struct{}{}
+
+// diff computes the merge patch describing how to turn a into b.
+func diff(a, b interface{}) interface{} {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+
+	if aok && bok {
+		return diffMap(am, bm)
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return unchanged
+	}
+
+	return b
+}
+
+// diffMap computes the merge patch object describing how to turn
+// a into b: keys removed in b become null, keys added or changed
+// in b are emitted, and unchanged keys are omitted.
+func diffMap(a, b map[string]interface{}) interface{} {
+	m := make(map[string]interface{}, len(b))
+
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			m[k] = nil
+		}
+	}
+
+	for k, bv := range b {
+		av, ok := a[k]
+
+		if !ok {
+			m[k] = bv
+
+			continue
+		}
+
+		if d := diff(av, bv); d != unchanged {
+			// diff returns an empty object, not unchanged, for two
+			// equal objects; omit those keys too.
+			if dm, ok := d.(map[string]interface{}); ok && len(dm) == 0 {
+				if _, ok := av.(map[string]interface{}); ok {
+					continue
+				}
+			}
+
+			m[k] = d
+		}
+	}
+
+	return m
+}
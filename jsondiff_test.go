@@ -0,0 +1,96 @@
+package jsonmp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffValue(t *testing.T) {
+	var a, b interface{}
+
+	json.Unmarshal([]byte(`{"a":"b","c":{"d":"e","f":"g"}}`), &a)
+	json.Unmarshal([]byte(`{"a":"b","c":{"d":"h"},"i":"j"}`), &b)
+
+	d, err := DiffValue(a, b)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"c": map[string]interface{}{"d": "h", "f": nil},
+		"i": "j",
+	}
+
+	if !reflect.DeepEqual(d, want) {
+		t.Fatalf("incorrect diff: %#v", d)
+	}
+}
+
+// containsNull reports whether v has an explicit null nested
+// inside an object. RFC 7386 merge patches can never produce
+// such a document, since null always means "remove" when
+// applied - an inherent limitation of the format, not of Diff.
+func containsNull(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+
+	if !ok {
+		return false
+	}
+
+	for _, c := range m {
+		if c == nil || containsNull(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestDiffRoundTrip asserts that Patch(a, Diff(a, b)) == b for
+// every testData case whose b can actually be represented as a
+// merge patch target (see containsNull).
+func TestDiffRoundTrip(t *testing.T) {
+	for i, c := range testData {
+		var a, b interface{}
+
+		if err := json.Unmarshal([]byte(c.a), &a); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := json.Unmarshal([]byte(c.b), &b); err != nil {
+			t.Fatal(err)
+		}
+
+		if containsNull(b) {
+			continue
+		}
+
+		d, err := DiffValue(a, b)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r interface{}
+
+		if err := PatchValue(a, d, &r); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(r, b) {
+			t.Fatalf("round-trip mismatch (%d): patch(a, diff(a,b)) != b", i)
+		}
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	b.ReportAllocs()
+
+	x, y := []byte(testData[15].a), []byte(testData[15].b)
+
+	for i := 0; i < b.N; i++ {
+		Diff(x, y)
+	}
+}
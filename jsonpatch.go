@@ -0,0 +1,503 @@
+// Copyright Praegressus Limited. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonmp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when an RFC 6902 JSON Patch operation cannot be
+// carried out against the target document.
+var (
+	// ErrPathNotFound is returned when a JSON Pointer does not
+	// resolve to a location required by the operation.
+	ErrPathNotFound = errors.New("jsonmp: path not found")
+
+	// ErrTestFailed is returned by a "test" operation when the
+	// value at path does not match the operation's value.
+	ErrTestFailed = errors.New("jsonmp: test operation failed")
+
+	// ErrInvalidOp is returned when an operation's "op" member
+	// is not one of add, remove, replace, move, copy or test.
+	ErrInvalidOp = errors.New("jsonmp: invalid operation")
+
+	// ErrInvalidPatch is returned when an operation is missing a
+	// member required by its op type.
+	ErrInvalidPatch = errors.New("jsonmp: invalid patch operation")
+)
+
+// operation is a single RFC 6902 JSON Patch operation.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies an RFC 6902 JSON Patch to the JSON document doc
+// and returns the patched document. Operations are applied
+// atomically: if any operation fails, nil is returned along with
+// the error and doc is left unmodified.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var a interface{}
+
+	if err := json.Unmarshal(doc, &a); err != nil {
+		return nil, err
+	}
+
+	var ops []operation
+
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+
+	r, err := applyOps(a, ops)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(r)
+}
+
+// ApplyValue applies the RFC 6902 JSON Patch ops to the interface
+// value a and stores the result in dst.
+func ApplyValue(a interface{}, ops []byte, dst interface{}) error {
+	var err error
+
+	if a, err = coerce(a); err != nil {
+		return err
+	}
+
+	var o []operation
+
+	if err = json.Unmarshal(ops, &o); err != nil {
+		return err
+	}
+
+	r, err := applyOps(a, o)
+
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &dst)
+}
+
+// Applier reads the patch operations from the Reader and writes
+// the patched result to the Writer when Apply() is called.
+type Applier struct {
+	r io.Reader
+	w io.Writer
+}
+
+// NewApplier returns a new Applier.
+func NewApplier(r io.Reader, w io.Writer) *Applier {
+	return &Applier{r, w}
+}
+
+// Apply applies the RFC 6902 JSON Patch operations read from the
+// Applier's Reader to the JSON byte value c. The result is
+// written to the Writer.
+func (a *Applier) Apply(c []byte) error {
+	var ops []operation
+
+	if err := json.NewDecoder(a.r).Decode(&ops); err != nil {
+		return err
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(c, &doc); err != nil {
+		return err
+	}
+
+	r, err := applyOps(doc, ops)
+
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(a.w).Encode(r)
+}
+
+// applyOps applies ops to a deep copy of doc, so that doc is left
+// untouched if any operation fails.
+func applyOps(doc interface{}, ops []operation) (interface{}, error) {
+	doc = deepCopy(doc)
+
+	var err error
+
+	for _, o := range ops {
+		if doc, err = applyOp(doc, o); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// applyOp applies a single operation to doc and returns the
+// resulting document.
+func applyOp(doc interface{}, o operation) (interface{}, error) {
+	switch o.Op {
+	case "add", "replace":
+		if o.Value == nil {
+			return nil, ErrInvalidPatch
+		}
+
+		v, err := decodeValue(o.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tokens, err := pointerTokens(o.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return applyAt(doc, tokens, o.Op, v)
+
+	case "remove":
+		tokens, err := pointerTokens(o.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return applyAt(doc, tokens, "remove", nil)
+
+	case "move", "copy":
+		if o.From == "" {
+			return nil, ErrInvalidPatch
+		}
+
+		if o.Op == "move" && (o.From == o.Path || strings.HasPrefix(o.Path, o.From+"/")) {
+			return nil, ErrInvalidPatch
+		}
+
+		fromTokens, err := pointerTokens(o.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := getValue(doc, fromTokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v = deepCopy(v)
+
+		if o.Op == "move" {
+			if doc, err = applyAt(doc, fromTokens, "remove", nil); err != nil {
+				return nil, err
+			}
+		}
+
+		toTokens, err := pointerTokens(o.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return applyAt(doc, toTokens, "add", v)
+
+	case "test":
+		tokens, err := pointerTokens(o.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := getValue(doc, tokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		want, err := decodeValue(o.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(v, want) {
+			return nil, ErrTestFailed
+		}
+
+		return doc, nil
+
+	default:
+		return nil, ErrInvalidOp
+	}
+}
+
+// decodeValue unmarshals a raw patch value, treating a missing
+// value as JSON null.
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var v interface{}
+
+	return v, json.Unmarshal(raw, &v)
+}
+
+// pointerTokens splits an RFC 6901 JSON Pointer into its
+// unescaped reference tokens. The root pointer ("") yields no
+// tokens.
+func pointerTokens(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if path[0] != '/' {
+		return nil, ErrPathNotFound
+	}
+
+	tokens := strings.Split(path[1:], "/")
+
+	for i, t := range tokens {
+		t = strings.ReplaceAll(t, "~1", "/")
+		t = strings.ReplaceAll(t, "~0", "~")
+		tokens[i] = t
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses tok as an array index valid in [0, length).
+func arrayIndex(tok string, length int) (int, error) {
+	i, err := strconv.Atoi(tok)
+
+	if err != nil || i < 0 || i >= length {
+		return 0, ErrPathNotFound
+	}
+
+	return i, nil
+}
+
+// getValue resolves tokens against doc and returns the value at
+// that location.
+func getValue(doc interface{}, tokens []string) (interface{}, error) {
+	cur := doc
+
+	for _, t := range tokens {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			val, ok := v[t]
+
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+
+			cur = val
+
+		case []interface{}:
+			i, err := arrayIndex(t, len(v))
+
+			if err != nil {
+				return nil, err
+			}
+
+			cur = v[i]
+
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+
+	return cur, nil
+}
+
+// applyAt applies an add, replace or remove operation at tokens
+// within doc, returning the resulting document.
+func applyAt(doc interface{}, tokens []string, mode string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		if mode == "remove" {
+			return nil, nil
+		}
+
+		return value, nil
+	}
+
+	head, tail := tokens[0], tokens[1:]
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if len(tail) == 0 {
+			return applyLeafMap(v, head, mode, value)
+		}
+
+		child, ok := v[head]
+
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+
+		c, err := applyAt(child, tail, mode, value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v[head] = c
+
+		return v, nil
+
+	case []interface{}:
+		if len(tail) == 0 {
+			return applyLeafArray(v, head, mode, value)
+		}
+
+		i, err := arrayIndex(head, len(v))
+
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := applyAt(v[i], tail, mode, value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v[i] = c
+
+		return v, nil
+
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// applyLeafMap applies mode to key of m.
+func applyLeafMap(m map[string]interface{}, key, mode string, value interface{}) (interface{}, error) {
+	switch mode {
+	case "add":
+		m[key] = value
+
+		return m, nil
+
+	case "replace":
+		if _, ok := m[key]; !ok {
+			return nil, ErrPathNotFound
+		}
+
+		m[key] = value
+
+		return m, nil
+
+	case "remove":
+		if _, ok := m[key]; !ok {
+			return nil, ErrPathNotFound
+		}
+
+		delete(m, key)
+
+		return m, nil
+
+	default:
+		return nil, ErrInvalidOp
+	}
+}
+
+// applyLeafArray applies mode at index tok of s.
+func applyLeafArray(s []interface{}, tok, mode string, value interface{}) (interface{}, error) {
+	switch mode {
+	case "add":
+		if tok == "-" {
+			return append(s, value), nil
+		}
+
+		i, err := strconv.Atoi(tok)
+
+		if err != nil || i < 0 || i > len(s) {
+			return nil, ErrPathNotFound
+		}
+
+		s = append(s, nil)
+		copy(s[i+1:], s[i:])
+		s[i] = value
+
+		return s, nil
+
+	case "replace":
+		i, err := arrayIndex(tok, len(s))
+
+		if err != nil {
+			return nil, err
+		}
+
+		s[i] = value
+
+		return s, nil
+
+	case "remove":
+		i, err := arrayIndex(tok, len(s))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return append(s[:i], s[i+1:]...), nil
+
+	default:
+		return nil, ErrInvalidOp
+	}
+}
+
+// deepCopy returns a recursive copy of v's maps and slices so
+// that mutating the result never affects v.
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k, val := range t {
+			m[k] = deepCopy(val)
+		}
+
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+
+		for i, val := range t {
+			s[i] = deepCopy(val)
+		}
+
+		return s
+
+	default:
+		return v
+	}
+}
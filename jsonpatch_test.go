@@ -0,0 +1,87 @@
+package jsonmp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var applyData = []struct {
+	doc, patch, result string
+	err                error
+}{
+	// RFC 6902 Appendix A examples
+	{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+	{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+	{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+	{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+	{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+	{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+	{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+	{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"remove","path":"/baz"}]`, `{}`, nil},
+	{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, ErrTestFailed},
+	{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, nil},
+	{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, ErrPathNotFound},
+	{`{"foo":"bar"}`, `[{"op":"invalid","path":"/foo"}]`, ``, ErrInvalidOp},
+	{`["foo","sil"]`, `[{"op":"add","path":"/bar","value":"qux"}]`, ``, ErrPathNotFound},
+	{`{"foo":"bar","qux":{"baz":1,"bar":null}}`, `[{"op":"copy","from":"/foo","path":"/qux/corge"}]`, `{"foo":"bar","qux":{"baz":1,"bar":null,"corge":"bar"}}`, nil},
+}
+
+func TestApply(t *testing.T) {
+	for i, c := range applyData {
+		p, err := Apply([]byte(c.doc), []byte(c.patch))
+
+		if c.err != nil {
+			if err != c.err {
+				t.Fatalf("test %d: expected error %v, got %v", i, c.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+
+		if r := fmtResult(c.result); r != string(p) {
+			t.Fatalf("incorrect result (%d): %s != %s", i, p, r)
+		}
+	}
+}
+
+func TestApplyAtomic(t *testing.T) {
+	doc := []byte(`{"foo":"bar"}`)
+	patch := []byte(`[{"op":"replace","path":"/foo","value":"baz"},{"op":"remove","path":"/nope"}]`)
+
+	if _, err := Apply(doc, patch); err != ErrPathNotFound {
+		t.Fatalf("expected %v, got %v", ErrPathNotFound, err)
+	}
+
+	var a interface{}
+
+	if err := json.Unmarshal(doc, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(a, map[string]interface{}{"foo": "bar"}) {
+		t.Fatal("source document was mutated on a failed patch")
+	}
+}
+
+func TestApplyValue(t *testing.T) {
+	var a interface{}
+
+	if err := json.Unmarshal([]byte(`{"foo":"bar"}`), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	var r interface{}
+
+	if err := ApplyValue(a, []byte(`[{"op":"add","path":"/baz","value":"qux"}]`), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(r, map[string]interface{}{"foo": "bar", "baz": "qux"}) {
+		t.Fatal("invalid result")
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright Praegressus Limited. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// StreamingPatcher applies an RFC 7386 merge patch to a document
+// without unmarshalling the document into an interface{} tree.
+// The patch, which is typically much smaller than the document
+// it targets, is read into a sparse tree once; the document is
+// then streamed member by member, with unaffected subtrees copied
+// to the output verbatim. Each unaffected member is read whole as
+// raw bytes before it is copied, so peak memory is proportional
+// to the size of the patch plus the largest unaffected member,
+// rather than the size of the whole document. A document whose
+// root is not an object is decoded whole.
+type StreamingPatcher struct {
+	doc, patch io.Reader
+	out        io.Writer
+}
+
+// NewStreamingPatcher returns a new StreamingPatcher.
+func NewStreamingPatcher(doc, patch io.Reader, out io.Writer) *StreamingPatcher {
+	return &StreamingPatcher{doc, patch, out}
+}
+
+// Patch streams the merge of the Reader and Patch documents to
+// the Writer.
+func (s *StreamingPatcher) Patch() error {
+	pb, err := io.ReadAll(s.patch)
+
+	if err != nil {
+		return err
+	}
+
+	var p interface{}
+
+	if err := json.Unmarshal(pb, &p); err != nil {
+		return err
+	}
+
+	pm, ok := p.(map[string]interface{})
+
+	if !ok {
+		// A non-object patch always replaces the document
+		// wholesale; nothing of the source is needed.
+		_, err := s.out.Write(pb)
+
+		return err
+	}
+
+	dec := json.NewDecoder(s.doc)
+
+	tok, err := dec.Token()
+
+	if err != nil {
+		return err
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		// The source document isn't an object, so RFC 7386
+		// merge semantics don't apply at the root; fall back
+		// to the regular whole-value patch rules.
+		a, err := decodeRemainder(dec, tok)
+
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(patch(a, pm))
+
+		if err != nil {
+			return err
+		}
+
+		_, err = s.out.Write(b)
+
+		return err
+	}
+
+	w := bufio.NewWriter(s.out)
+
+	if err := mergeObject(dec, pm, w); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// decodeRemainder decodes the value following tok, which has
+// already been read from dec, into a generic interface{}.
+func decodeRemainder(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	if tok != json.Delim('[') {
+		return tok, nil
+	}
+
+	var s []interface{}
+
+	for dec.More() {
+		var v interface{}
+
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		s = append(s, v)
+	}
+
+	_, err := dec.Token() // consume ']'
+
+	return s, err
+}
+
+// mergeObject streams the object whose opening '{' has just been
+// read from dec, applying the merge patch p and writing the
+// result to w.
+func mergeObject(dec *json.Decoder, p map[string]interface{}, w *bufio.Writer) error {
+	w.WriteByte('{')
+
+	first := true
+	seen := make(map[string]bool, len(p))
+
+	for dec.More() {
+		tok, err := dec.Token()
+
+		if err != nil {
+			return err
+		}
+
+		key := tok.(string)
+		seen[key] = true
+
+		pv, exists := p[key]
+
+		if exists && pv == nil {
+			// Removed by the patch: discard the source value.
+			var raw json.RawMessage
+
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !first {
+			w.WriteByte(',')
+		}
+
+		first = false
+
+		if err := writeKey(w, key); err != nil {
+			return err
+		}
+
+		if !exists {
+			// Unchanged: copy the source subtree verbatim.
+			var raw json.RawMessage
+
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+
+			w.Write(raw)
+
+			continue
+		}
+
+		pmv, isObj := pv.(map[string]interface{})
+
+		if !isObj {
+			// Non-object patch value overrides the source
+			// value wholesale.
+			var raw json.RawMessage
+
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+
+			vb, err := json.Marshal(pv)
+
+			if err != nil {
+				return err
+			}
+
+			w.Write(vb)
+
+			continue
+		}
+
+		sub, err := dec.Token()
+
+		if err != nil {
+			return err
+		}
+
+		if d, ok := sub.(json.Delim); ok && d == '{' {
+			if err := mergeObject(dec, pmv, w); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// The patch holds an object but the source value
+		// doesn't: the patch object wins wholesale.
+		if err := skipValue(dec, sub); err != nil {
+			return err
+		}
+
+		vb, err := json.Marshal(removeNull(pmv))
+
+		if err != nil {
+			return err
+		}
+
+		w.Write(vb)
+	}
+
+	if _, err := dec.Token(); err != nil { // consume '}'
+		return err
+	}
+
+	return writePatchOnlyKeys(w, p, seen, &first)
+}
+
+// writePatchOnlyKeys emits keys present in p but not in seen,
+// i.e. keys the patch adds that the source document lacked.
+func writePatchOnlyKeys(w *bufio.Writer, p map[string]interface{}, seen map[string]bool, first *bool) error {
+	for k, v := range p {
+		if seen[k] || v == nil {
+			continue
+		}
+
+		if !*first {
+			w.WriteByte(',')
+		}
+
+		*first = false
+
+		if err := writeKey(w, k); err != nil {
+			return err
+		}
+
+		if m, ok := v.(map[string]interface{}); ok {
+			v = removeNull(m)
+		}
+
+		vb, err := json.Marshal(v)
+
+		if err != nil {
+			return err
+		}
+
+		w.Write(vb)
+	}
+
+	w.WriteByte('}')
+
+	return nil
+}
+
+// writeKey writes a JSON object key followed by a colon.
+func writeKey(w *bufio.Writer, key string) error {
+	kb, err := json.Marshal(key)
+
+	if err != nil {
+		return err
+	}
+
+	w.Write(kb)
+
+	return w.WriteByte(':')
+}
+
+// skipValue discards the remainder of the JSON value that began
+// with the already-read token first, by tracking balanced
+// '{'/'[' and '}'/']' delimiters.
+func skipValue(dec *json.Decoder, first json.Token) error {
+	d, ok := first.(json.Delim)
+
+	if !ok || d == '}' || d == ']' {
+		return nil
+	}
+
+	depth := 1
+
+	for depth > 0 {
+		tok, err := dec.Token()
+
+		if err != nil {
+			return err
+		}
+
+		d, ok := tok.(json.Delim)
+
+		if !ok {
+			continue
+		}
+
+		switch d {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package jsonmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamingPatcher(t *testing.T) {
+	for i, c := range testData {
+		var (
+			buf = &bytes.Buffer{}
+			sp  = NewStreamingPatcher(strings.NewReader(c.a), strings.NewReader(c.b), buf)
+		)
+
+		if err := sp.Patch(); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+
+		var a interface{}
+
+		if err := json.Unmarshal(buf.Bytes(), &a); err != nil {
+			t.Fatalf("test %d: %v (output: %s)", i, err, buf.Bytes())
+		}
+
+		var b interface{}
+
+		if err := json.Unmarshal([]byte(c.result), &b); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("incorrect result for test data %d: %s", i, buf.Bytes())
+		}
+	}
+}
+
+// TestStreamingPatcherNoTrailingNewline asserts that the output,
+// like json.Marshal's, has no trailing newline, regardless of
+// whether the source document's root is an object
+// (the fast path) or an array/scalar (the fallback path).
+func TestStreamingPatcherNoTrailingNewline(t *testing.T) {
+	cases := []struct{ doc, patch string }{
+		{`{"a":1}`, `{"b":2}`},
+		{`[1,2,3]`, `{"b":2}`},
+		{`"foo"`, `{"b":2}`},
+	}
+
+	for i, c := range cases {
+		buf := &bytes.Buffer{}
+		sp := NewStreamingPatcher(strings.NewReader(c.doc), strings.NewReader(c.patch), buf)
+
+		if err := sp.Patch(); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+
+		if bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			t.Fatalf("test %d: unexpected trailing newline: %q", i, buf.Bytes())
+		}
+	}
+}
+
+func BenchmarkStreamingPatcher(b *testing.B) {
+	b.ReportAllocs()
+
+	var (
+		buf = &bytes.Buffer{}
+		doc = testData[15].a
+		p   = testData[15].b
+	)
+
+	for i := 0; i < b.N; i++ {
+		sp := NewStreamingPatcher(strings.NewReader(doc), strings.NewReader(p), buf)
+
+		sp.Patch()
+		buf.Reset()
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright Praegressus Limited. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonmp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Errors returned by PatchStruct.
+var (
+	// ErrInvalidTarget is returned when dst is not a non-nil
+	// pointer to a struct.
+	ErrInvalidTarget = errors.New("jsonmp: dst must be a non-nil pointer to a struct")
+
+	// ErrUnknownField is returned, when DisallowUnknownFields is
+	// set, for a patch key that doesn't match any field.
+	ErrUnknownField = errors.New("jsonmp: unknown field")
+
+	// ErrImmutableField is returned for a patch key matching a
+	// path passed to Immutable.
+	ErrImmutableField = errors.New("jsonmp: immutable field")
+
+	// ErrTypeMismatch is returned when a patch value's JSON
+	// shape is incompatible with the destination field's type.
+	ErrTypeMismatch = errors.New("jsonmp: patch value incompatible with field type")
+)
+
+// StructOpt configures PatchStruct.
+type StructOpt func(*structOptions)
+
+type structOptions struct {
+	disallowUnknown bool
+	immutable       map[string]bool
+	maxDepth        int
+}
+
+// DisallowUnknownFields causes PatchStruct to fail with
+// ErrUnknownField when the patch contains a key that doesn't
+// match any field of the destination struct (or, at nested
+// levels, of the matching struct field).
+func DisallowUnknownFields() StructOpt {
+	return func(o *structOptions) { o.disallowUnknown = true }
+}
+
+// Immutable marks fields, identified by dot-separated paths of
+// their JSON names (e.g. "author.familyName"), that must not
+// appear in the patch. PatchStruct fails with ErrImmutableField
+// if one does.
+func Immutable(fields []string) StructOpt {
+	return func(o *structOptions) {
+		o.immutable = make(map[string]bool, len(fields))
+
+		for _, f := range fields {
+			o.immutable[f] = true
+		}
+	}
+}
+
+// MaxDepth limits struct nesting the patch is allowed to recurse
+// into; exceeding it fails with ErrMaxDepth. The default is
+// unlimited.
+func MaxDepth(n int) StructOpt {
+	return func(o *structOptions) { o.maxDepth = n }
+}
+
+// ErrMaxDepth is returned when a patch nests deeper than the
+// depth configured with MaxDepth.
+var ErrMaxDepth = errors.New("jsonmp: patch exceeds max depth")
+
+// PatchStruct patches dst, a pointer to a struct, in place with
+// the RFC 7386 merge patch document in patch. Unlike
+// PatchValueWithBytes, it walks dst's fields directly via
+// reflection instead of round-tripping through interface{} and
+// encoding/json, using cached json-tag field maps to resolve
+// patch keys. A JSON null zeroes the matching field (or, for map
+// fields, deletes the key); nested structs, pointers and maps are
+// patched recursively.
+func PatchStruct(dst interface{}, patch []byte, opts ...StructOpt) error {
+	o := &structOptions{maxDepth: -1}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	v := reflect.ValueOf(dst)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	var p map[string]interface{}
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return err
+	}
+
+	// Stage the patch on a clone of dst so that a failing patch
+	// (unknown field, immutable field, type mismatch) never
+	// leaves dst partially modified; the clone is only committed
+	// back to dst once the whole patch has applied cleanly.
+	orig := v.Elem()
+	work := cloneValue(orig)
+
+	if err := patchStructValue(work, p, o, 0, ""); err != nil {
+		return err
+	}
+
+	orig.Set(work)
+
+	return nil
+}
+
+// cloneValue returns a copy of v that shares no mutable state
+// (pointees, maps, slices) with v, so that it can be patched
+// freely without affecting the original. Unexported fields are
+// preserved via a whole-struct copy, since PatchStruct never
+// touches them.
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(cloneValue(v.Elem()))
+
+		return p
+
+	case reflect.Struct:
+		s := reflect.New(v.Type()).Elem()
+		s.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			f := s.Field(i)
+
+			if !f.CanSet() {
+				continue
+			}
+
+			f.Set(cloneValue(v.Field(i)))
+		}
+
+		return s
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+
+		for _, k := range v.MapKeys() {
+			m.SetMapIndex(k, cloneValue(v.MapIndex(k)))
+		}
+
+		return m
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(cloneValue(v.Index(i)))
+		}
+
+		return s
+
+	default:
+		return v
+	}
+}
+
+// structField is the cached location and JSON name of a struct
+// field.
+type structField struct {
+	index []int
+	name  string
+}
+
+var fieldCache sync.Map // map[reflect.Type]map[string]structField
+
+// fieldsOf returns t's fields keyed by their JSON name, honoring
+// the `json` tag's name and "-" skip directive and promoting
+// anonymous (embedded) struct fields, the way encoding/json does.
+// Shallower fields win over deeper ones with the same name. The
+// result is cached per type.
+func fieldsOf(t reflect.Type) map[string]structField {
+	if m, ok := fieldCache.Load(t); ok {
+		return m.(map[string]structField)
+	}
+
+	type queued struct {
+		t     reflect.Type
+		index []int
+	}
+
+	m := make(map[string]structField)
+	queue := []queued{{t, nil}}
+
+	for len(queue) > 0 {
+		var next []queued
+
+		for _, q := range queue {
+			for i := 0; i < q.t.NumField(); i++ {
+				f := q.t.Field(i)
+
+				if f.PkgPath != "" && !f.Anonymous {
+					continue
+				}
+
+				tag := f.Tag.Get("json")
+
+				if tag == "-" {
+					continue
+				}
+
+				name := f.Name
+				explicit := false
+
+				if c := strings.IndexByte(tag, ','); c >= 0 {
+					tag = tag[:c]
+				}
+
+				if tag != "" {
+					name = tag
+					explicit = true
+				}
+
+				index := make([]int, 0, len(q.index)+1)
+				index = append(index, q.index...)
+				index = append(index, i)
+
+				if f.Anonymous && !explicit {
+					ft := f.Type
+
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+
+					if ft.Kind() == reflect.Struct {
+						next = append(next, queued{ft, index})
+
+						continue
+					}
+				}
+
+				if _, ok := m[name]; ok {
+					continue
+				}
+
+				m[name] = structField{index: index, name: name}
+			}
+		}
+
+		queue = next
+	}
+
+	fieldCache.Store(t, m)
+
+	return m
+}
+
+// fieldByIndex walks index from v as reflect.Value.FieldByIndex
+// does, except that a nil pointer to an embedded struct along the
+// path is allocated rather than causing a panic.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		v = v.Field(x)
+
+		if i < len(index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+	}
+
+	return v
+}
+
+// lookupField resolves key against fields, preferring an exact
+// match and falling back to a case-insensitive one, matching
+// encoding/json's unmarshalling rules.
+func lookupField(fields map[string]structField, key string) (structField, bool) {
+	if f, ok := fields[key]; ok {
+		return f, true
+	}
+
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+
+	return structField{}, false
+}
+
+// patchStructValue applies the patch keys in p to the struct
+// value v.
+func patchStructValue(v reflect.Value, p map[string]interface{}, o *structOptions, depth int, prefix string) error {
+	if o.maxDepth >= 0 && depth > o.maxDepth {
+		return ErrMaxDepth
+	}
+
+	fields := fieldsOf(v.Type())
+
+	for key, val := range p {
+		f, ok := lookupField(fields, key)
+
+		if !ok {
+			if o.disallowUnknown {
+				return fmt.Errorf("%w: %s", ErrUnknownField, key)
+			}
+
+			continue
+		}
+
+		path := f.name
+
+		if prefix != "" {
+			path = prefix + "." + f.name
+		}
+
+		if o.immutable[path] {
+			return fmt.Errorf("%w: %s", ErrImmutableField, path)
+		}
+
+		if err := patchField(fieldByIndex(v, f.index), val, o, depth, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patchField applies a single patch value to the field fv.
+func patchField(fv reflect.Value, val interface{}, o *structOptions, depth int, path string) error {
+	if val == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+
+		return nil
+	}
+
+	switch {
+	case fv.Kind() == reflect.Ptr:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+
+		return patchField(fv.Elem(), val, o, depth, path)
+
+	case fv.Kind() == reflect.Struct:
+		vm, ok := val.(map[string]interface{})
+
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTypeMismatch, path)
+		}
+
+		return patchStructValue(fv, vm, o, depth+1, path)
+
+	case fv.Kind() == reflect.Map && fv.Type().Key().Kind() == reflect.String:
+		vm, ok := val.(map[string]interface{})
+
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTypeMismatch, path)
+		}
+
+		return patchMapValue(fv, vm, o, depth, path)
+	}
+
+	b, err := json.Marshal(val)
+
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, fv.Addr().Interface()); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrTypeMismatch, path, err)
+	}
+
+	return nil
+}
+
+// patchMapValue applies patch to a string-keyed map field,
+// deleting keys patched to null and patching each other key's
+// existing value, if any, recursively.
+func patchMapValue(fv reflect.Value, patch map[string]interface{}, o *structOptions, depth int, path string) error {
+	if fv.IsNil() {
+		fv.Set(reflect.MakeMap(fv.Type()))
+	}
+
+	kt := fv.Type().Key()
+	et := fv.Type().Elem()
+
+	for k, val := range patch {
+		// The key's Kind is guaranteed to be String by the
+		// caller, but it may be a named string type (e.g.
+		// `type Label string`); Convert adapts it rather than
+		// handing SetMapIndex a plain string, which panics.
+		key := reflect.ValueOf(k).Convert(kt)
+
+		if val == nil {
+			fv.SetMapIndex(key, reflect.Value{})
+
+			continue
+		}
+
+		ev := reflect.New(et).Elem()
+
+		if old := fv.MapIndex(key); old.IsValid() {
+			ev.Set(old)
+		}
+
+		if err := patchField(ev, val, o, depth, path+"."+k); err != nil {
+			return err
+		}
+
+		fv.SetMapIndex(key, ev)
+	}
+
+	return nil
+}
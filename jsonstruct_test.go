@@ -0,0 +1,191 @@
+package jsonmp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPatchStruct(t *testing.T) {
+	var a, r *testStruct
+
+	if err := json.Unmarshal([]byte(testData[15].a), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(testData[15].result), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PatchStruct(a, []byte(testData[15].b)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(a, r) {
+		t.Fatalf("invalid result: %+v", a)
+	}
+}
+
+func TestPatchStructNullZeroesField(t *testing.T) {
+	s := &testStruct{Title: "foo", Content: "bar"}
+
+	if err := PatchStruct(s, []byte(`{"content":null}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Content != "" {
+		t.Fatalf("expected Content to be zeroed, got %q", s.Content)
+	}
+
+	if s.Title != "foo" {
+		t.Fatalf("unrelated field Title was modified: %q", s.Title)
+	}
+}
+
+func TestPatchStructDisallowUnknownFields(t *testing.T) {
+	s := &testStruct{}
+
+	err := PatchStruct(s, []byte(`{"nope":"x"}`), DisallowUnknownFields())
+
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestPatchStructImmutable(t *testing.T) {
+	s := &testStruct{Title: "foo"}
+
+	err := PatchStruct(s, []byte(`{"title":"bar"}`), Immutable([]string{"title"}))
+
+	if err == nil {
+		t.Fatal("expected an error for an immutable field")
+	}
+
+	if s.Title != "foo" {
+		t.Fatalf("immutable field was modified: %q", s.Title)
+	}
+}
+
+func TestPatchStructMaxDepth(t *testing.T) {
+	s := &testStruct{Author: &author{GivenName: "John"}}
+
+	err := PatchStruct(s, []byte(`{"author":{"givenName":"Jane"}}`), MaxDepth(0))
+
+	if err == nil {
+		t.Fatal("expected an error for exceeding max depth")
+	}
+}
+
+func TestPatchStructAtomic(t *testing.T) {
+	s := &testStruct{Title: "orig-title", Content: "orig-content"}
+
+	err := PatchStruct(s, []byte(`{"title":"new-title","content":"new-content","bogus":1}`), DisallowUnknownFields())
+
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	if s.Title != "orig-title" || s.Content != "orig-content" {
+		t.Fatalf("dst was partially modified by a failing patch: %+v", s)
+	}
+}
+
+func TestPatchStructAtomicNested(t *testing.T) {
+	s := &testStruct{Author: &author{GivenName: "John", FamilyName: "Doe"}}
+	before := *s.Author
+
+	err := PatchStruct(s, []byte(`{"author":{"givenName":"Jane"},"bogus":1}`), DisallowUnknownFields())
+
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	if *s.Author != before {
+		t.Fatalf("nested struct was modified by a failing patch: %+v", s.Author)
+	}
+}
+
+type embedded struct {
+	Foo string `json:"foo"`
+}
+
+type outer struct {
+	embedded
+	Bar string `json:"bar"`
+}
+
+func TestPatchStructEmbedded(t *testing.T) {
+	o := &outer{}
+
+	if err := PatchStruct(o, []byte(`{"foo":"hello","bar":"world"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Foo != "hello" || o.Bar != "world" {
+		t.Fatalf("promoted embedded field was not patched: %+v", o)
+	}
+}
+
+func TestPatchStructEmbeddedDisallowUnknownFields(t *testing.T) {
+	o := &outer{}
+
+	if err := PatchStruct(o, []byte(`{"foo":"hello"}`), DisallowUnknownFields()); err != nil {
+		t.Fatalf("promoted embedded field incorrectly rejected as unknown: %v", err)
+	}
+}
+
+// label is a named string type, used to exercise map fields keyed
+// by something other than a plain string.
+type label string
+
+type withMap struct {
+	Counts map[label]int `json:"counts"`
+}
+
+func TestPatchStructMapField(t *testing.T) {
+	s := &withMap{Counts: map[label]int{"a": 1, "b": 2}}
+
+	if err := PatchStruct(s, []byte(`{"counts":{"b":3,"c":4,"a":null}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[label]int{"b": 3, "c": 4}
+
+	if !reflect.DeepEqual(s.Counts, want) {
+		t.Fatalf("incorrect map result: %+v", s.Counts)
+	}
+}
+
+func TestPatchStructMapFieldNilMap(t *testing.T) {
+	s := &withMap{}
+
+	if err := PatchStruct(s, []byte(`{"counts":{"a":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (map[label]int{"a": 1}); !reflect.DeepEqual(s.Counts, want) {
+		t.Fatalf("incorrect map result: %+v", s.Counts)
+	}
+}
+
+func TestPatchStructInvalidTarget(t *testing.T) {
+	if err := PatchStruct(testStruct{}, []byte(`{}`)); err != ErrInvalidTarget {
+		t.Fatalf("expected %v, got %v", ErrInvalidTarget, err)
+	}
+}
+
+func BenchmarkPatchStruct(b *testing.B) {
+	b.ReportAllocs()
+
+	var x *testStruct
+
+	json.Unmarshal([]byte(testData[15].a), &x)
+
+	p := []byte(testData[15].b)
+
+	for i := 0; i < b.N; i++ {
+		y := *x
+
+		PatchStruct(&y, p)
+	}
+}